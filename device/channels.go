@@ -8,55 +8,327 @@ package device
 import (
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
 )
 
-// An outboundQueue is a channel of QueueOutboundElements awaiting encryption.
-// An outboundQueue is ref-counted using its wg field.
+// QueueBatchSize is the maximum number of elements RoutineReadFromTUN and
+// RoutineReceiveIncoming accumulate before handing a batch off to the
+// encryption/decryption workers in a single channel send. Batching
+// amortizes channel synchronization overhead across many packets, in the
+// same spirit as GSO/GRO on the wire.
+const QueueBatchSize = 128
+
+// QueuePrioritySize is the capacity of the high-priority lane carrying
+// handshake retransmits, cookie replies, and keepalives. It is kept small
+// and separate from QueueOutboundSize/QueueInboundSize so control traffic
+// never has to wait behind a flood of queued data packets.
+const QueuePrioritySize = 64
+
+// dropLogInterval bounds how often a saturated queue logs at Verbosef, so a
+// sustained stall logs once per interval instead of once per dropped batch.
+const dropLogInterval = time.Second
+
+// queueMetrics holds the atomically-updated depth/drop counters shared by
+// outboundQueue, inboundQueue, and handshakeQueue. Depth itself is read
+// straight off the channel's len(), since that's already authoritative;
+// queueMetrics only tracks what the channel can't tell you on its own.
+type queueMetrics struct {
+	highWater   uint32 // atomic: highest depth observed at enqueue time
+	enqueued    uint64 // atomic: total successful enqueues
+	dropped     uint64 // atomic: total enqueues abandoned because the queue was full
+	lastLogNano int64  // atomic: UnixNano of the last rate-limited drop log
+}
+
+// recordEnqueue counts one successful send and raises the high-water mark to
+// depth, the channel's length right after that send, if depth is higher.
+func (m *queueMetrics) recordEnqueue(depth int) {
+	atomic.AddUint64(&m.enqueued, 1)
+	for {
+		hw := atomic.LoadUint32(&m.highWater)
+		if uint32(depth) <= hw || atomic.CompareAndSwapUint32(&m.highWater, hw, uint32(depth)) {
+			return
+		}
+	}
+}
+
+// recordDrop counts a drop and, at most once per dropLogInterval, logs it.
+func (m *queueMetrics) recordDrop(logger *Logger) {
+	atomic.AddUint64(&m.dropped, 1)
+	if logger == nil {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&m.lastLogNano)
+	if now-last < int64(dropLogInterval) {
+		return
+	}
+	if atomic.CompareAndSwapInt64(&m.lastLogNano, last, now) {
+		logger.Verbosef("Dropping batch: queue is full (%d dropped total)", atomic.LoadUint64(&m.dropped))
+	}
+}
+
+// QueueMetricsSnapshot is a point-in-time readout of a queue's depth and
+// backpressure counters, as returned by Device.QueueStats.
+type QueueMetricsSnapshot struct {
+	Depth     int
+	HighWater uint32
+	Enqueued  uint64
+	Dropped   uint64
+}
+
+func (m *queueMetrics) snapshot(depth int) QueueMetricsSnapshot {
+	return QueueMetricsSnapshot{
+		Depth:     depth,
+		HighWater: atomic.LoadUint32(&m.highWater),
+		Enqueued:  atomic.LoadUint64(&m.enqueued),
+		Dropped:   atomic.LoadUint64(&m.dropped),
+	}
+}
+
+// An outboundQueue is a channel of batches of QueueOutboundElements awaiting
+// encryption. Each send carries up to QueueBatchSize elements rather than
+// one, so a single channel operation amortizes across many packets.
+// It also carries a second, small-capacity highC lane reserved for
+// handshake retransmits, cookie replies, and keepalives, so a flood of
+// data packets on c cannot delay control traffic; workers should always
+// drain highC before c, which Receive does for them.
+// An outboundQueue is ref-counted using its wg field, which covers writers
+// on both lanes.
 // An outboundQueue created with newOutboundQueue has one reference.
 // Every additional writer must call wg.Add(1).
 // Every completed writer must call wg.Done().
 // When no further writers will be added,
 // call wg.Done to remove the initial reference.
-// When the refcount hits 0, the queue's channel is closed.
+// When the refcount hits 0, both of the queue's channels are closed.
 type outboundQueue struct {
-	c  chan *QueueOutboundElement
-	wg sync.WaitGroup
+	device *Device
+	c      chan []*QueueOutboundElement
+	highC  chan []*QueueOutboundElement
+	wg     sync.WaitGroup
+	queueMetrics
+	highMetrics queueMetrics
 }
 
-func newOutboundQueue() *outboundQueue {
+func newOutboundQueue(device *Device) *outboundQueue {
 	q := &outboundQueue{
-		c: make(chan *QueueOutboundElement, QueueOutboundSize),
+		device: device,
+		c:      make(chan []*QueueOutboundElement, QueueOutboundSize),
+		highC:  make(chan []*QueueOutboundElement, QueuePrioritySize),
 	}
 	q.wg.Add(1)
 	go func() {
 		q.wg.Wait()
 		close(q.c)
+		close(q.highC)
 	}()
 	return q
 }
 
-// A inboundQueue is similar to an outboundQueue; see those docs.
+// Send delivers batch to the normal lane without blocking indefinitely. If
+// the channel is full it waits up to timeout (0 meaning not at all) before giving up,
+// incrementing the drop counter and logging at a rate-limited verbosity
+// rather than stalling the caller indefinitely.
+func (q *outboundQueue) Send(batch []*QueueOutboundElement, timeout time.Duration, logger *Logger) bool {
+	return sendOutbound(q.c, &q.queueMetrics, batch, timeout, logger)
+}
+
+// SendHigh delivers a single high-priority element — a handshake
+// retransmit, cookie reply, or keepalive — on the priority lane, subject
+// to the same non-blocking/timeout/drop-counting behavior as Send.
+func (q *outboundQueue) SendHigh(elem *QueueOutboundElement, timeout time.Duration, logger *Logger) bool {
+	batch := append(getOutboundElementsSlice(), elem)
+	if sendOutbound(q.highC, &q.highMetrics, batch, timeout, logger) {
+		return true
+	}
+	releaseOutboundBatch(q.device, batch)
+	return false
+}
+
+// SendNormal delivers a single data-plane element on the normal lane. It
+// is a convenience over Send for callers that have one element rather
+// than an already-accumulated batch.
+func (q *outboundQueue) SendNormal(elem *QueueOutboundElement, timeout time.Duration, logger *Logger) bool {
+	batch := append(getOutboundElementsSlice(), elem)
+	if sendOutbound(q.c, &q.queueMetrics, batch, timeout, logger) {
+		return true
+	}
+	releaseOutboundBatch(q.device, batch)
+	return false
+}
+
+// Receive returns the next batch to process, always preferring highC over
+// c so control traffic never waits behind a backlog of data packets. It
+// reports ok == false only once both lanes are closed and drained; a
+// closed-but-empty highC must not be mistaken for "nothing left at all",
+// since c can still hold batches.
+func (q *outboundQueue) Receive() (batch []*QueueOutboundElement, ok bool) {
+	high, normal := q.highC, q.c
+	for {
+		select {
+		case batch, ok = <-high:
+			if ok {
+				return
+			}
+			high = nil
+		default:
+		}
+		if high == nil && normal == nil {
+			return nil, false
+		}
+		select {
+		case batch, ok = <-high:
+			if ok {
+				return
+			}
+			high = nil
+		case batch, ok = <-normal:
+			if ok {
+				return
+			}
+			normal = nil
+		}
+	}
+}
+
+// sendOutbound tries a non-blocking send first, since that is the common
+// case on a queue with room to spare, and only pays for a time.Timer when
+// the channel is actually full — allocating one on every call would
+// undercut the batching this queue exists to amortize.
+func sendOutbound(c chan []*QueueOutboundElement, m *queueMetrics, batch []*QueueOutboundElement, timeout time.Duration, logger *Logger) bool {
+	select {
+	case c <- batch:
+		m.recordEnqueue(len(c))
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		m.recordDrop(logger)
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case c <- batch:
+		m.recordEnqueue(len(c))
+		return true
+	case <-timer.C:
+		m.recordDrop(logger)
+		return false
+	}
+}
+
+// A inboundQueue is similar to an outboundQueue, including its
+// high-priority lane; see those docs.
 type inboundQueue struct {
-	c  chan *QueueInboundElement
-	wg sync.WaitGroup
+	device *Device
+	c      chan []*QueueInboundElement
+	highC  chan []*QueueInboundElement
+	wg     sync.WaitGroup
+	queueMetrics
+	highMetrics queueMetrics
 }
 
-func newInboundQueue() *inboundQueue {
+func newInboundQueue(device *Device) *inboundQueue {
 	q := &inboundQueue{
-		c: make(chan *QueueInboundElement, QueueInboundSize),
+		device: device,
+		c:      make(chan []*QueueInboundElement, QueueInboundSize),
+		highC:  make(chan []*QueueInboundElement, QueuePrioritySize),
 	}
 	q.wg.Add(1)
 	go func() {
 		q.wg.Wait()
 		close(q.c)
+		close(q.highC)
 	}()
 	return q
 }
 
+// Send is the inbound-side equivalent of outboundQueue.Send; see those docs.
+func (q *inboundQueue) Send(batch []*QueueInboundElement, timeout time.Duration, logger *Logger) bool {
+	return sendInbound(q.c, &q.queueMetrics, batch, timeout, logger)
+}
+
+// SendHigh is the inbound-side equivalent of outboundQueue.SendHigh; see those docs.
+func (q *inboundQueue) SendHigh(elem *QueueInboundElement, timeout time.Duration, logger *Logger) bool {
+	batch := append(getInboundElementsSlice(), elem)
+	if sendInbound(q.highC, &q.highMetrics, batch, timeout, logger) {
+		return true
+	}
+	releaseInboundBatch(q.device, batch)
+	return false
+}
+
+// SendNormal is the inbound-side equivalent of outboundQueue.SendNormal; see those docs.
+func (q *inboundQueue) SendNormal(elem *QueueInboundElement, timeout time.Duration, logger *Logger) bool {
+	batch := append(getInboundElementsSlice(), elem)
+	if sendInbound(q.c, &q.queueMetrics, batch, timeout, logger) {
+		return true
+	}
+	releaseInboundBatch(q.device, batch)
+	return false
+}
+
+// Receive is the inbound-side equivalent of outboundQueue.Receive; see those docs.
+func (q *inboundQueue) Receive() (batch []*QueueInboundElement, ok bool) {
+	high, normal := q.highC, q.c
+	for {
+		select {
+		case batch, ok = <-high:
+			if ok {
+				return
+			}
+			high = nil
+		default:
+		}
+		if high == nil && normal == nil {
+			return nil, false
+		}
+		select {
+		case batch, ok = <-high:
+			if ok {
+				return
+			}
+			high = nil
+		case batch, ok = <-normal:
+			if ok {
+				return
+			}
+			normal = nil
+		}
+	}
+}
+
+// sendInbound is the inbound-side equivalent of sendOutbound; see those docs.
+func sendInbound(c chan []*QueueInboundElement, m *queueMetrics, batch []*QueueInboundElement, timeout time.Duration, logger *Logger) bool {
+	select {
+	case c <- batch:
+		m.recordEnqueue(len(c))
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		m.recordDrop(logger)
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case c <- batch:
+		m.recordEnqueue(len(c))
+		return true
+	case <-timer.C:
+		m.recordDrop(logger)
+		return false
+	}
+}
+
 // A handshakeQueue is similar to an outboundQueue; see those docs.
 type handshakeQueue struct {
 	c  chan QueueHandshakeElement
 	wg sync.WaitGroup
+	queueMetrics
 }
 
 func newHandshakeQueue() *handshakeQueue {
@@ -71,59 +343,379 @@ func newHandshakeQueue() *handshakeQueue {
 	return q
 }
 
-// newAutodrainingInboundQueue returns a channel that will be drained when it gets GC'd.
-// It is useful in cases in which is it hard to manage the lifetime of the channel.
-// The returned channel must not be closed. Senders should signal shutdown using
-// some other means, such as sending a sentinel nil values.
-func newAutodrainingInboundQueue(device *Device) chan *QueueInboundElement {
-	type autodrainingInboundQueue struct {
-		c chan *QueueInboundElement
+// Send is the handshake-queue equivalent of outboundQueue.Send; see those docs.
+func (q *handshakeQueue) Send(elem QueueHandshakeElement, timeout time.Duration, logger *Logger) bool {
+	select {
+	case q.c <- elem:
+		q.recordEnqueue(len(q.c))
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		q.recordDrop(logger)
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case q.c <- elem:
+		q.recordEnqueue(len(q.c))
+		return true
+	case <-timer.C:
+		q.recordDrop(logger)
+		return false
+	}
+}
+
+// QueueStatsSnapshot is a point-in-time readout of every queue tracked by a
+// Device, as returned by Device.QueueStats and surfaced read-only over
+// UAPI (queue_outbound_depth=, queue_outbound_dropped=, and so on).
+// OutboundHigh and InboundHigh cover the priority lane carrying handshake
+// retransmits, cookie replies, and keepalives, so a saturated priority
+// lane is just as visible as a saturated normal one.
+type QueueStatsSnapshot struct {
+	Outbound     QueueMetricsSnapshot
+	OutboundHigh QueueMetricsSnapshot
+	Inbound      QueueMetricsSnapshot
+	InboundHigh  QueueMetricsSnapshot
+	Handshake    QueueMetricsSnapshot
+}
+
+// QueueStats returns a snapshot of the current depth and backpressure
+// counters for device's outbound, inbound, and handshake queues. The
+// outbound/inbound queues are sharded across GOMAXPROCS workers, so their
+// snapshots are combined across every shard by addQueueMetricsSnapshot.
+func (device *Device) QueueStats() QueueStatsSnapshot {
+	hs := device.queue.handshake
+	stats := QueueStatsSnapshot{
+		Handshake: hs.queueMetrics.snapshot(len(hs.c)),
+	}
+	for _, shard := range device.queue.encryption.shards {
+		stats.Outbound = addQueueMetricsSnapshot(stats.Outbound, shard.queueMetrics.snapshot(len(shard.c)))
+		stats.OutboundHigh = addQueueMetricsSnapshot(stats.OutboundHigh, shard.highMetrics.snapshot(len(shard.highC)))
+	}
+	for _, shard := range device.queue.decryption.shards {
+		stats.Inbound = addQueueMetricsSnapshot(stats.Inbound, shard.queueMetrics.snapshot(len(shard.c)))
+		stats.InboundHigh = addQueueMetricsSnapshot(stats.InboundHigh, shard.highMetrics.snapshot(len(shard.highC)))
+	}
+	return stats
+}
+
+// addQueueMetricsSnapshot combines two shards' snapshots into one: depths
+// and counters sum, while HighWater takes the larger of the two so the
+// aggregate still reflects the busiest shard's peak.
+func addQueueMetricsSnapshot(a, b QueueMetricsSnapshot) QueueMetricsSnapshot {
+	highWater := a.HighWater
+	if b.HighWater > highWater {
+		highWater = b.HighWater
+	}
+	return QueueMetricsSnapshot{
+		Depth:     a.Depth + b.Depth,
+		HighWater: highWater,
+		Enqueued:  a.Enqueued + b.Enqueued,
+		Dropped:   a.Dropped + b.Dropped,
+	}
+}
+
+// shardOverflowNumerator and shardOverflowDenominator define how full (as a
+// fraction of QueueOutboundSize/QueueInboundSize) a peer's preferred shard
+// may get before a shardedOutboundQueue/shardedInboundQueue diverts new
+// batches round-robin to whichever shard the producer lands on next,
+// trading strict per-peer shard affinity for throughput once that shard is
+// backed up.
+const (
+	shardOverflowNumerator   = 3
+	shardOverflowDenominator = 4
+)
+
+// spillIndex picks a shard other than preferredIdx to receive overflow
+// batches, round-robin across the remaining n-1 shards, so an already
+// overloaded shard is never handed still more work by its own overflow
+// path. With only one shard, there is nowhere else to spill to.
+func spillIndex(preferredIdx, n uint32, next *uint32) uint32 {
+	if n <= 1 {
+		return preferredIdx
+	}
+	step := atomic.AddUint32(next, 1) % (n - 1)
+	return (preferredIdx + 1 + step) % n
+}
+
+// A shardedOutboundQueue fans outboundQueue out across nShards independent
+// channels so that GOMAXPROCS encryption workers don't contend on one
+// channel's internal mutex. A peer's batches are routed to the same shard
+// for the lifetime of the queue (by hashing the peer pointer), which keeps
+// a single peer's packets in order on a single worker — the sequential-
+// sender invariant depends on this. When a peer's preferred shard is
+// backed up beyond the overflow threshold, batches spill round-robin to
+// whichever shard is next, since ordering no longer matters once a peer is
+// already behind.
+//
+// A shardedOutboundQueue is ref-counted the same way as outboundQueue,
+// except Add/Done fan out across every shard's own wg so each shard's
+// channel still closes only once every writer across all shards is done.
+type shardedOutboundQueue struct {
+	shards []*outboundQueue
+	next   uint32
+}
+
+func newShardedOutboundQueue(device *Device, nShards int) *shardedOutboundQueue {
+	if nShards < 1 {
+		nShards = 1
+	}
+	q := &shardedOutboundQueue{shards: make([]*outboundQueue, nShards)}
+	for i := range q.shards {
+		q.shards[i] = newOutboundQueue(device)
+	}
+	return q
+}
+
+// Add registers delta additional writers across every shard.
+func (q *shardedOutboundQueue) Add(delta int) {
+	for _, shard := range q.shards {
+		shard.wg.Add(delta)
+	}
+}
+
+// Done removes one writer reference from every shard.
+func (q *shardedOutboundQueue) Done() {
+	for _, shard := range q.shards {
+		shard.wg.Done()
+	}
+}
+
+// shardIndexFor returns the index of the shard that owns peer's traffic.
+func (q *shardedOutboundQueue) shardIndexFor(peer *Peer) uint32 {
+	h := uintptr(unsafe.Pointer(peer)) >> 4
+	return uint32(h % uintptr(len(q.shards)))
+}
+
+// shardFor returns the shard that owns peer's traffic.
+func (q *shardedOutboundQueue) shardFor(peer *Peer) *outboundQueue {
+	return q.shards[q.shardIndexFor(peer)]
+}
+
+// Send delivers batch to peer's preferred shard, or spills it round-robin
+// to another shard if the preferred one is over the overflow threshold.
+// Like outboundQueue.Send, it never blocks indefinitely: it waits up to
+// timeout before giving up, recording a drop against whichever shard it
+// gave up on, so a saturated shard cannot stall the caller.
+func (q *shardedOutboundQueue) Send(peer *Peer, batch []*QueueOutboundElement, timeout time.Duration, logger *Logger) bool {
+	preferredIdx := q.shardIndexFor(peer)
+	preferred := q.shards[preferredIdx]
+	if len(preferred.c)*shardOverflowDenominator < cap(preferred.c)*shardOverflowNumerator {
+		return preferred.Send(batch, timeout, logger)
+	}
+	return q.shards[spillIndex(preferredIdx, uint32(len(q.shards)), &q.next)].Send(batch, timeout, logger)
+}
+
+// SendHigh delivers elem on peer's preferred shard's priority lane, so
+// handshake retransmits, cookie replies, and keepalives stay ahead of
+// queued data packets even when encryption work is sharded across
+// workers.
+func (q *shardedOutboundQueue) SendHigh(peer *Peer, elem *QueueOutboundElement, timeout time.Duration, logger *Logger) bool {
+	return q.shardFor(peer).SendHigh(elem, timeout, logger)
+}
+
+// SendNormal delivers a single data-plane element on peer's preferred
+// shard's normal lane.
+func (q *shardedOutboundQueue) SendNormal(peer *Peer, elem *QueueOutboundElement, timeout time.Duration, logger *Logger) bool {
+	return q.shardFor(peer).SendNormal(elem, timeout, logger)
+}
+
+// A shardedInboundQueue is the receive-side equivalent of
+// shardedOutboundQueue; see those docs.
+type shardedInboundQueue struct {
+	shards []*inboundQueue
+	next   uint32
+}
+
+func newShardedInboundQueue(device *Device, nShards int) *shardedInboundQueue {
+	if nShards < 1 {
+		nShards = 1
+	}
+	q := &shardedInboundQueue{shards: make([]*inboundQueue, nShards)}
+	for i := range q.shards {
+		q.shards[i] = newInboundQueue(device)
+	}
+	return q
+}
+
+func (q *shardedInboundQueue) Add(delta int) {
+	for _, shard := range q.shards {
+		shard.wg.Add(delta)
+	}
+}
+
+func (q *shardedInboundQueue) Done() {
+	for _, shard := range q.shards {
+		shard.wg.Done()
 	}
+}
+
+// shardIndexFor is the inbound-side equivalent of shardedOutboundQueue.shardIndexFor; see those docs.
+func (q *shardedInboundQueue) shardIndexFor(peer *Peer) uint32 {
+	h := uintptr(unsafe.Pointer(peer)) >> 4
+	return uint32(h % uintptr(len(q.shards)))
+}
+
+func (q *shardedInboundQueue) shardFor(peer *Peer) *inboundQueue {
+	return q.shards[q.shardIndexFor(peer)]
+}
+
+// Send is the inbound-side equivalent of shardedOutboundQueue.Send; see those docs.
+func (q *shardedInboundQueue) Send(peer *Peer, batch []*QueueInboundElement, timeout time.Duration, logger *Logger) bool {
+	preferredIdx := q.shardIndexFor(peer)
+	preferred := q.shards[preferredIdx]
+	if len(preferred.c)*shardOverflowDenominator < cap(preferred.c)*shardOverflowNumerator {
+		return preferred.Send(batch, timeout, logger)
+	}
+	return q.shards[spillIndex(preferredIdx, uint32(len(q.shards)), &q.next)].Send(batch, timeout, logger)
+}
+
+// SendHigh is the inbound-side equivalent of shardedOutboundQueue.SendHigh; see those docs.
+func (q *shardedInboundQueue) SendHigh(peer *Peer, elem *QueueInboundElement, timeout time.Duration, logger *Logger) bool {
+	return q.shardFor(peer).SendHigh(elem, timeout, logger)
+}
+
+// SendNormal is the inbound-side equivalent of shardedOutboundQueue.SendNormal; see those docs.
+func (q *shardedInboundQueue) SendNormal(peer *Peer, elem *QueueInboundElement, timeout time.Duration, logger *Logger) bool {
+	return q.shardFor(peer).SendNormal(elem, timeout, logger)
+}
+
+// outboundElementsPool and inboundElementsPool hand out the batch slices
+// carried over outboundQueue.c / inboundQueue.c, so that accumulating a
+// batch never allocates on the hot path. They sit alongside the existing
+// PutMessageBuffer/PutInboundElement plumbing: a batch is returned to its
+// pool only after every element in it has been released back to its own
+// pool first.
+var outboundElementsPool = sync.Pool{
+	New: func() any {
+		return make([]*QueueOutboundElement, 0, QueueBatchSize)
+	},
+}
+
+var inboundElementsPool = sync.Pool{
+	New: func() any {
+		return make([]*QueueInboundElement, 0, QueueBatchSize)
+	},
+}
+
+// getOutboundElementsSlice returns an empty, zero-length batch slice ready
+// to be appended to.
+func getOutboundElementsSlice() []*QueueOutboundElement {
+	return outboundElementsPool.Get().([]*QueueOutboundElement)[:0]
+}
+
+// putOutboundElementsSlice returns a batch slice to its pool. The caller
+// must have already released every element of the batch.
+func putOutboundElementsSlice(batch []*QueueOutboundElement) {
+	outboundElementsPool.Put(batch[:0]) //nolint:staticcheck
+}
+
+// getInboundElementsSlice returns an empty, zero-length batch slice ready
+// to be appended to.
+func getInboundElementsSlice() []*QueueInboundElement {
+	return inboundElementsPool.Get().([]*QueueInboundElement)[:0]
+}
+
+// putInboundElementsSlice returns a batch slice to its pool. The caller
+// must have already released every element of the batch.
+func putInboundElementsSlice(batch []*QueueInboundElement) {
+	inboundElementsPool.Put(batch[:0]) //nolint:staticcheck
+}
+
+// releaseInboundBatch returns every element of batch to device's pools,
+// along with batch's own slice, so a batch that is dropped or drained
+// rather than handed to a worker still gives back everything it holds.
+func releaseInboundBatch(device *Device, batch []*QueueInboundElement) {
+	for _, elem := range batch {
+		if elem == nil {
+			continue
+		}
+		device.PutMessageBuffer(elem.buffer)
+		device.PutInboundElement(elem)
+	}
+	if batch != nil {
+		putInboundElementsSlice(batch)
+	}
+}
+
+// releaseOutboundBatch is the outbound-side equivalent of
+// releaseInboundBatch; see those docs.
+func releaseOutboundBatch(device *Device, batch []*QueueOutboundElement) {
+	for _, elem := range batch {
+		if elem == nil {
+			continue
+		}
+		device.PutMessageBuffer(elem.buffer)
+		device.PutOutboundElement(elem)
+	}
+	if batch != nil {
+		putOutboundElementsSlice(batch)
+	}
+}
+
+func drainInboundChannel(device *Device, c chan []*QueueInboundElement) {
+	for {
+		select {
+		case batch := <-c:
+			releaseInboundBatch(device, batch)
+		default:
+			return
+		}
+	}
+}
+
+func drainOutboundChannel(device *Device, c chan []*QueueOutboundElement) {
+	for {
+		select {
+		case batch := <-c:
+			releaseOutboundBatch(device, batch)
+		default:
+			return
+		}
+	}
+}
+
+// autodrainingInboundQueue holds the normal and high-priority lanes for a
+// queue that will be drained when it gets GC'd, instead of through an
+// explicit shutdown. It is useful in cases in which it is hard to manage
+// the lifetime of the channels. Neither channel must be closed; senders
+// should signal shutdown using some other means, such as a sentinel nil
+// batch.
+type autodrainingInboundQueue struct {
+	c     chan []*QueueInboundElement
+	highC chan []*QueueInboundElement
+}
+
+func newAutodrainingInboundQueue(device *Device) *autodrainingInboundQueue {
 	q := &autodrainingInboundQueue{
-		c: make(chan *QueueInboundElement, QueueInboundSize),
+		c:     make(chan []*QueueInboundElement, QueueInboundSize),
+		highC: make(chan []*QueueInboundElement, QueuePrioritySize),
 	}
 	runtime.SetFinalizer(q, func(q *autodrainingInboundQueue) {
-		for {
-			select {
-			case elem := <-q.c:
-				if elem == nil {
-					continue
-				}
-				device.PutMessageBuffer(elem.buffer)
-				device.PutInboundElement(elem)
-			default:
-				return
-			}
-		}
+		drainInboundChannel(device, q.c)
+		drainInboundChannel(device, q.highC)
 	})
-	return q.c
+	return q
 }
 
-// newAutodrainingOutboundQueue returns a channel that will be drained when it gets GC'd.
-// It is useful in cases in which is it hard to manage the lifetime of the channel.
-// The returned channel must not be closed. Senders should signal shutdown using
-// some other means, such as sending a sentinel nil values.
-// All sends to the channel must be best-effort, because there may be no receivers.
-func newAutodrainingOutboundQueue(device *Device) chan *QueueOutboundElement {
-	type autodrainingOutboundQueue struct {
-		c chan *QueueOutboundElement
-	}
+// autodrainingOutboundQueue is the outbound-side equivalent of
+// autodrainingInboundQueue; see those docs. All sends to either lane must
+// be best-effort, because there may be no receivers.
+type autodrainingOutboundQueue struct {
+	c     chan []*QueueOutboundElement
+	highC chan []*QueueOutboundElement
+}
+
+func newAutodrainingOutboundQueue(device *Device) *autodrainingOutboundQueue {
 	q := &autodrainingOutboundQueue{
-		c: make(chan *QueueOutboundElement, QueueOutboundSize),
+		c:     make(chan []*QueueOutboundElement, QueueOutboundSize),
+		highC: make(chan []*QueueOutboundElement, QueuePrioritySize),
 	}
 	runtime.SetFinalizer(q, func(q *autodrainingOutboundQueue) {
-		for {
-			select {
-			case elem := <-q.c:
-				if elem == nil {
-					continue
-				}
-				device.PutMessageBuffer(elem.buffer)
-				device.PutOutboundElement(elem)
-			default:
-				return
-			}
-		}
+		drainOutboundChannel(device, q.c)
+		drainOutboundChannel(device, q.highC)
 	})
-	return q.c
+	return q
 }
@@ -0,0 +1,142 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"runtime"
+	"sync"
+)
+
+// TUNDevice is the local interface to the tunnel device, analogous to
+// tun.Device in the sibling tun package.
+type TUNDevice interface {
+	Read(buf []byte) (int, error)
+	Write(buf []byte) (int, error)
+}
+
+// Endpoint identifies where a peer's transport messages are sent.
+type Endpoint interface{}
+
+// Bind is the local interface to the UDP transport, analogous to
+// conn.Bind in the sibling conn package.
+type Bind interface {
+	Send(packet []byte, endpoint Endpoint) error
+	Receive(buf []byte) (int, Endpoint, error)
+}
+
+// A Device is a WireGuard tunnel: it owns the TUN interface, the UDP
+// bind, the peer table, and the outbound/inbound/handshake queues that
+// connect them.
+type Device struct {
+	log *Logger
+	tun TUNDevice
+	net struct {
+		bind Bind
+	}
+	peers struct {
+		sync.RWMutex
+		byPublicKey map[string]*Peer
+		byAllowedIP map[string]*Peer
+		byEndpoint  map[Endpoint]*Peer
+	}
+	queue struct {
+		encryption *shardedOutboundQueue
+		decryption *shardedInboundQueue
+		handshake  *handshakeQueue
+	}
+	pool struct {
+		messageBuffers   sync.Pool
+		inboundElements  sync.Pool
+		outboundElements sync.Pool
+	}
+}
+
+// NewDevice constructs a Device around tun/bind and starts its TUN-reader,
+// encryption, packet-receiver, and decryption routines.
+func NewDevice(tun TUNDevice, bind Bind, log *Logger) *Device {
+	device := &Device{log: log, tun: tun}
+	device.net.bind = bind
+	device.peers.byPublicKey = make(map[string]*Peer)
+	device.peers.byAllowedIP = make(map[string]*Peer)
+	device.peers.byEndpoint = make(map[Endpoint]*Peer)
+
+	device.pool.messageBuffers.New = func() any {
+		buf := make([]byte, MessageBufferSize)
+		return &buf
+	}
+	device.pool.inboundElements.New = func() any {
+		return new(QueueInboundElement)
+	}
+	device.pool.outboundElements.New = func() any {
+		return new(QueueOutboundElement)
+	}
+
+	nShards := runtime.GOMAXPROCS(0)
+	device.queue.encryption = newShardedOutboundQueue(device, nShards)
+	device.queue.decryption = newShardedInboundQueue(device, nShards)
+	device.queue.handshake = newHandshakeQueue()
+
+	go device.RoutineReadFromTUN()
+	go device.RoutineReceiveIncoming()
+	for i := 0; i < nShards; i++ {
+		go device.RoutineEncryption(i)
+		go device.RoutineDecryption(i)
+	}
+
+	return device
+}
+
+// GetMessageBuffer returns a pooled buffer sized MessageBufferSize.
+func (device *Device) GetMessageBuffer() *[]byte {
+	return device.pool.messageBuffers.Get().(*[]byte)
+}
+
+// PutMessageBuffer returns buf to its pool.
+func (device *Device) PutMessageBuffer(buf *[]byte) {
+	device.pool.messageBuffers.Put(buf)
+}
+
+// GetInboundElement returns a pooled, zeroed QueueInboundElement.
+func (device *Device) GetInboundElement() *QueueInboundElement {
+	return device.pool.inboundElements.Get().(*QueueInboundElement)
+}
+
+// PutInboundElement returns elem to its pool.
+func (device *Device) PutInboundElement(elem *QueueInboundElement) {
+	*elem = QueueInboundElement{}
+	device.pool.inboundElements.Put(elem)
+}
+
+// GetOutboundElement returns a pooled, zeroed QueueOutboundElement.
+func (device *Device) GetOutboundElement() *QueueOutboundElement {
+	return device.pool.outboundElements.Get().(*QueueOutboundElement)
+}
+
+// PutOutboundElement returns elem to its pool.
+func (device *Device) PutOutboundElement(elem *QueueOutboundElement) {
+	*elem = QueueOutboundElement{}
+	device.pool.outboundElements.Put(elem)
+}
+
+// LookupPeer returns the peer that should receive packet, based on
+// packet's IPv4 destination address, or nil if no peer owns it.
+func (device *Device) LookupPeer(packet []byte) *Peer {
+	if len(packet) < 20 {
+		return nil
+	}
+	dst := string(packet[16:20])
+	device.peers.RLock()
+	defer device.peers.RUnlock()
+	return device.peers.byAllowedIP[dst]
+}
+
+// lookupPeerByEndpoint returns the peer currently associated with
+// endpoint, or nil if none is.
+func (device *Device) lookupPeerByEndpoint(endpoint Endpoint) *Peer {
+	device.peers.RLock()
+	defer device.peers.RUnlock()
+	return device.peers.byEndpoint[endpoint]
+}
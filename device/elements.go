@@ -0,0 +1,37 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+// A QueueOutboundElement is a packet on its way out to a peer: either a
+// plaintext packet awaiting encryption (one read off the TUN device, or an
+// empty keepalive), or an already-formed control message (handshake
+// initiation, cookie reply) that only needs to be handed to the peer's
+// endpoint.
+type QueueOutboundElement struct {
+	packet []byte  // the plaintext (pre-encryption) or already-final wire bytes
+	buffer *[]byte // pooled buffer packet is sliced from
+	peer   *Peer
+
+	// skipEncryption is set on control messages that are already in their
+	// final wire form (handshake initiation, cookie reply) so that
+	// RoutineEncryption forwards packet as-is instead of sealing it.
+	skipEncryption bool
+}
+
+// A QueueInboundElement is a packet received from a peer's endpoint,
+// awaiting decryption before it is written to the TUN device.
+type QueueInboundElement struct {
+	packet []byte
+	buffer *[]byte
+	peer   *Peer
+}
+
+// A QueueHandshakeElement is a handshake message queued for processing by
+// the handshake worker.
+type QueueHandshakeElement struct {
+	packet []byte
+	peer   *Peer
+}
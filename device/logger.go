@@ -0,0 +1,17 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+// LogLevelFunc is the signature used for each logging level on Logger.
+type LogLevelFunc func(format string, args ...interface{})
+
+// A Logger provides logging at a couple of levels. Code that may be handed
+// a nil *Logger checks the pointer for nil and then skips logging; the
+// LogLevelFunc fields of a non-nil Logger are called without a nil check.
+type Logger struct {
+	Verbosef LogLevelFunc
+	Errorf   LogLevelFunc
+}
@@ -0,0 +1,76 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import "net"
+
+// A Peer is one of device's tunnel endpoints.
+type Peer struct {
+	device   *Device
+	endpoint Endpoint
+}
+
+// NewPeer registers a new peer identified by publicKey and returns it.
+func (device *Device) NewPeer(publicKey string) *Peer {
+	peer := &Peer{device: device}
+	device.peers.Lock()
+	defer device.peers.Unlock()
+	device.peers.byPublicKey[publicKey] = peer
+	return peer
+}
+
+// AddAllowedIP routes packets destined for ip to peer.
+func (device *Device) AddAllowedIP(peer *Peer, ip net.IP) {
+	device.peers.Lock()
+	defer device.peers.Unlock()
+	device.peers.byAllowedIP[string(ip.To4())] = peer
+}
+
+// SetEndpoint records where peer's transport messages should be sent, and
+// routes incoming messages from that endpoint back to peer.
+func (peer *Peer) SetEndpoint(endpoint Endpoint) {
+	peer.device.peers.Lock()
+	defer peer.device.peers.Unlock()
+	peer.endpoint = endpoint
+	peer.device.peers.byEndpoint[endpoint] = peer
+}
+
+// SendKeepalive queues an empty keepalive packet on peer's high-priority
+// lane, so it reaches the wire ahead of any backlog of queued data
+// packets instead of waiting behind them.
+func (peer *Peer) SendKeepalive() bool {
+	elem := peer.device.GetOutboundElement()
+	elem.buffer = peer.device.GetMessageBuffer()
+	elem.packet = (*elem.buffer)[:0]
+	elem.peer = peer
+	return peer.device.queue.encryption.SendHigh(peer, elem, queueSendTimeout, peer.device.log)
+}
+
+// SendHandshakeInitiation queues an already-formed handshake-initiation
+// message on peer's high-priority lane, skipping the encryption step
+// since the message is already in its final wire form.
+func (peer *Peer) SendHandshakeInitiation(message []byte) bool {
+	return peer.sendControlMessage(message)
+}
+
+// SendCookieReply is the equivalent of SendHandshakeInitiation for an
+// already-formed cookie-reply message.
+func (peer *Peer) SendCookieReply(message []byte) bool {
+	return peer.sendControlMessage(message)
+}
+
+// sendControlMessage queues an already-final wire message — a handshake
+// initiation or cookie reply — on peer's high-priority lane.
+func (peer *Peer) sendControlMessage(message []byte) bool {
+	elem := peer.device.GetOutboundElement()
+	buf := peer.device.GetMessageBuffer()
+	n := copy(*buf, message)
+	elem.buffer = buf
+	elem.packet = (*buf)[:n]
+	elem.peer = peer
+	elem.skipEncryption = true
+	return peer.device.queue.encryption.SendHigh(peer, elem, queueSendTimeout, peer.device.log)
+}
@@ -0,0 +1,18 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+// Channel and buffer sizes shared by the device's queues and pools.
+const (
+	QueueOutboundSize  = 1024
+	QueueInboundSize   = 1024
+	QueueHandshakeSize = 1024
+
+	// MessageBufferSize is the size of the pooled buffers backing every
+	// QueueOutboundElement/QueueInboundElement. It is large enough for the
+	// largest possible transport message.
+	MessageBufferSize = 2048
+)
@@ -0,0 +1,88 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+// RoutineReceiveIncoming reads transport messages off the bind and
+// accumulates them, up to QueueBatchSize at a time, into batches from a
+// single peer before handing each batch to the decryption queue in one
+// send, mirroring RoutineReadFromTUN.
+func (device *Device) RoutineReceiveIncoming() {
+	batch := getInboundElementsSlice()
+	var batchPeer *Peer
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if !device.queue.decryption.Send(batchPeer, batch, queueSendTimeout, device.log) {
+			releaseInboundBatch(device, batch)
+		}
+		batch = getInboundElementsSlice()
+	}
+
+	for {
+		elem := device.GetInboundElement()
+		elem.buffer = device.GetMessageBuffer()
+
+		n, endpoint, err := device.net.bind.Receive(*elem.buffer)
+		if err != nil {
+			device.PutMessageBuffer(elem.buffer)
+			device.PutInboundElement(elem)
+			flush()
+			return
+		}
+		elem.packet = (*elem.buffer)[:n]
+
+		peer := device.lookupPeerByEndpoint(endpoint)
+		if peer == nil {
+			device.PutMessageBuffer(elem.buffer)
+			device.PutInboundElement(elem)
+			continue
+		}
+		elem.peer = peer
+
+		if batchPeer != nil && peer != batchPeer {
+			flush()
+		}
+		batchPeer = peer
+		batch = append(batch, elem)
+
+		if len(batch) >= QueueBatchSize {
+			flush()
+			batchPeer = nil
+		}
+	}
+}
+
+// RoutineDecryption drains batches from shardIndex's shard of the
+// decryption queue, preferring the high-priority lane, opens each element
+// in place, and writes the resulting plaintext to the TUN device.
+// GOMAXPROCS instances of RoutineDecryption run, one per shard, so that
+// decryption work for different peers proceeds on independent channels.
+func (device *Device) RoutineDecryption(shardIndex int) {
+	shard := device.queue.decryption.shards[shardIndex]
+	for {
+		batch, ok := shard.Receive()
+		if !ok {
+			return
+		}
+		for _, elem := range batch {
+			openInPlace(elem.packet)
+			_, _ = device.tun.Write(elem.packet)
+			device.PutMessageBuffer(elem.buffer)
+			device.PutInboundElement(elem)
+		}
+		putInboundElementsSlice(batch)
+	}
+}
+
+// openInPlace is the inverse of sealInPlace: it XORs every byte of packet
+// with 0xa5 in place; see sealInPlace's doc comment.
+func openInPlace(packet []byte) {
+	for i := range packet {
+		packet[i] ^= 0xa5
+	}
+}
@@ -0,0 +1,103 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import "time"
+
+// queueSendTimeout bounds how long RoutineReadFromTUN and
+// RoutineReceiveIncoming wait for a queue to drain before dropping a
+// batch, so a stalled worker cannot block the reader indefinitely.
+const queueSendTimeout = time.Millisecond
+
+// RoutineReadFromTUN reads packets off the TUN device and accumulates
+// them, up to QueueBatchSize at a time, into batches addressed to a
+// single peer before handing each batch to the encryption queue in one
+// send — this amortizes channel synchronization across many packets
+// instead of paying it per packet.
+func (device *Device) RoutineReadFromTUN() {
+	batch := getOutboundElementsSlice()
+	var batchPeer *Peer
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if !device.queue.encryption.Send(batchPeer, batch, queueSendTimeout, device.log) {
+			releaseOutboundBatch(device, batch)
+		}
+		batch = getOutboundElementsSlice()
+	}
+
+	for {
+		elem := device.GetOutboundElement()
+		elem.buffer = device.GetMessageBuffer()
+
+		n, err := device.tun.Read(*elem.buffer)
+		if err != nil {
+			device.PutMessageBuffer(elem.buffer)
+			device.PutOutboundElement(elem)
+			flush()
+			return
+		}
+		elem.packet = (*elem.buffer)[:n]
+
+		peer := device.LookupPeer(elem.packet)
+		if peer == nil {
+			device.PutMessageBuffer(elem.buffer)
+			device.PutOutboundElement(elem)
+			continue
+		}
+		elem.peer = peer
+
+		if batchPeer != nil && peer != batchPeer {
+			flush()
+		}
+		batchPeer = peer
+		batch = append(batch, elem)
+
+		if len(batch) >= QueueBatchSize {
+			flush()
+			batchPeer = nil
+		}
+	}
+}
+
+// RoutineEncryption drains batches from shardIndex's shard of the
+// encryption queue, preferring the high-priority lane, seals each element
+// not marked skipEncryption (handshake initiations and cookie replies are
+// already in their final wire form; keepalives are sealed like data), and
+// forwards the result to the peer's endpoint.
+// GOMAXPROCS instances of RoutineEncryption run, one per shard, so that
+// encryption work for different peers proceeds on independent channels.
+func (device *Device) RoutineEncryption(shardIndex int) {
+	shard := device.queue.encryption.shards[shardIndex]
+	for {
+		batch, ok := shard.Receive()
+		if !ok {
+			return
+		}
+		for _, elem := range batch {
+			if !elem.skipEncryption {
+				sealInPlace(elem.packet)
+			}
+			if elem.peer != nil && device.net.bind != nil {
+				_ = device.net.bind.Send(elem.packet, elem.peer.endpoint)
+			}
+			device.PutMessageBuffer(elem.buffer)
+			device.PutOutboundElement(elem)
+		}
+		putOutboundElementsSlice(batch)
+	}
+}
+
+// sealInPlace is the seam RoutineEncryption calls to seal packet in place.
+// It XORs every byte of packet with 0xa5; it uses no peer keypair and does
+// not encrypt or authenticate the packet.
+func sealInPlace(packet []byte) {
+	for i := range packet {
+		packet[i] ^= 0xa5
+	}
+}
@@ -0,0 +1,70 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2021 WireGuard LLC. All Rights Reserved.
+ */
+
+package device
+
+import (
+	"fmt"
+	"io"
+)
+
+// IpcGetOperation implements the UAPI get=1 operation: one line per peer
+// followed by a block of queue_* keys reporting each queue's depth and
+// backpressure counters, so an operator can see a saturated or dropping
+// queue without attaching a profiler. Like every UAPI get, the output is
+// terminated by a blank line preceded by errno=0.
+func (device *Device) IpcGetOperation(w io.Writer) error {
+	if err := device.ipcGetPeers(w); err != nil {
+		return err
+	}
+	if err := device.ipcGetQueueStats(w); err != nil {
+		return err
+	}
+	_, err := fmt.Fprint(w, "errno=0\n\n")
+	return err
+}
+
+// ipcGetPeers writes the standard public_key= line for every registered peer.
+func (device *Device) ipcGetPeers(w io.Writer) error {
+	device.peers.RLock()
+	defer device.peers.RUnlock()
+	for publicKey := range device.peers.byPublicKey {
+		if _, err := fmt.Fprintf(w, "public_key=%x\n", publicKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ipcGetQueueStats appends device.QueueStats as queue_<lane>_<counter>=
+// lines, one block per lane.
+func (device *Device) ipcGetQueueStats(w io.Writer) error {
+	stats := device.QueueStats()
+	lines := []struct {
+		prefix string
+		stats  QueueMetricsSnapshot
+	}{
+		{"queue_outbound_", stats.Outbound},
+		{"queue_outbound_high_", stats.OutboundHigh},
+		{"queue_inbound_", stats.Inbound},
+		{"queue_inbound_high_", stats.InboundHigh},
+		{"queue_handshake_", stats.Handshake},
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w, "%sdepth=%d\n", line.prefix, line.stats.Depth); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%shigh_water=%d\n", line.prefix, line.stats.HighWater); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%senqueued=%d\n", line.prefix, line.stats.Enqueued); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%sdropped=%d\n", line.prefix, line.stats.Dropped); err != nil {
+			return err
+		}
+	}
+	return nil
+}